@@ -32,8 +32,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/secret"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 // AgentClusterInstallReconciler reconciles a AgentClusterInstall object
@@ -92,31 +94,44 @@ func (r *AgentClusterInstallReconciler) reconcile(
 	aci *hiveext.AgentClusterInstall,
 	acp *controlplanev1alpha1.AgentControlPlane,
 ) error {
-	if !hasKubeconfigRef(aci) {
-		return nil
-	}
+	clusterName := acp.Labels[clusterv1.ClusterNameLabel]
 
-	kubeconfigSecret, err := r.getACIKubeconfig(ctx, aci, *acp)
-	if err != nil {
+	if err := r.adoptUserProvidedSecrets(ctx, acp, clusterName); err != nil {
 		return err
 	}
 
-	clusterName := acp.Labels[clusterv1.ClusterNameLabel]
-	labels := map[string]string{
-		clusterv1.ClusterNameLabel: clusterName,
-	}
+	if acp.Spec.AgentConfigSpec.AdminKubeconfigRef == nil {
+		// The user didn't pre-create a kubeconfig secret, so fall back to copying the one
+		// assisted-service publishes on the ACI once it's available.
+		if !hasKubeconfigRef(aci) {
+			return nil
+		}
+		kubeconfigSecret, err := r.getACIKubeconfig(ctx, aci, *acp)
+		if err != nil {
+			return err
+		}
 
-	if err := r.updateLabels(ctx, kubeconfigSecret, labels); err != nil {
-		return err
-	}
+		labels := map[string]string{
+			clusterv1.ClusterNameLabel: clusterName,
+		}
 
-	if !r.ClusterKubeconfigSecretExists(ctx, clusterName, acp.Namespace) {
-		if err := r.createKubeconfig(ctx, kubeconfigSecret, clusterName, *acp); err != nil {
+		if err := r.updateLabels(ctx, kubeconfigSecret, labels); err != nil {
 			return err
 		}
+
+		if !r.ClusterKubeconfigSecretExists(ctx, clusterName, acp.Namespace) {
+			if err := r.createKubeconfig(ctx, kubeconfigSecret, clusterName, *acp); err != nil {
+				return err
+			}
+		}
 	}
 
 	acp.Status.Initialized = true
+	if isImported(aci) {
+		// Imported (day-2) clusters are already installed outside of CAPI, so there is no
+		// assisted-service install to wait on before the control plane is considered ready.
+		acp.Status.Ready = true
+	}
 	if err := r.Client.Status().Update(ctx, acp); err != nil {
 		return err
 	}
@@ -150,6 +165,70 @@ func (r *AgentClusterInstallReconciler) createKubeconfig(
 	return nil
 }
 
+// adoptUserProvidedSecrets adopts any BYO CAPI secrets (ca, etcd, sa, front-proxy certs, and admin
+// kubeconfig) the user pre-created in the AgentControlPlane's namespace, following the existing
+// cluster.x-k8s.io/secret naming and labeling conventions. Secrets the user did not supply a ref
+// for are left untouched: we never generate certificates (or a kubeconfig) ourselves. Validating
+// the kubeconfig secret's name here, rather than adopting it under its original name, matters
+// because the CAPI Cluster controller only considers the control plane initialized once a secret
+// literally named "<clusterName>-kubeconfig" exists; see createKubeconfig.
+func (r *AgentClusterInstallReconciler) adoptUserProvidedSecrets(
+	ctx context.Context,
+	acp *controlplanev1alpha1.AgentControlPlane,
+	clusterName string,
+) error {
+	certRefs := map[secret.Purpose]*corev1.LocalObjectReference{
+		secret.ClusterCA:      acp.Spec.AgentConfigSpec.CARef,
+		secret.EtcdCA:         acp.Spec.AgentConfigSpec.EtcdRef,
+		secret.ServiceAccount: acp.Spec.AgentConfigSpec.SARef,
+		secret.FrontProxyCA:   acp.Spec.AgentConfigSpec.FrontProxyRef,
+		secret.Kubeconfig:     acp.Spec.AgentConfigSpec.AdminKubeconfigRef,
+	}
+
+	for purpose, ref := range certRefs {
+		if ref == nil {
+			continue
+		}
+		certSecret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: acp.Namespace}, certSecret); err != nil {
+			return err
+		}
+		if expectedName := secret.Name(clusterName, purpose); certSecret.Name != expectedName {
+			return errors.Errorf("user-supplied %s secret %q must be named %q", purpose, certSecret.Name, expectedName)
+		}
+		if err := r.adoptSecret(ctx, certSecret, clusterName, acp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptSecret takes ownership of a secret the user pre-created, so that CAPI recognizes it as
+// belonging to this AgentControlPlane/cluster. Adoption is idempotent: re-adopting a secret we
+// already control is a no-op, and a secret already controlled by a different object returns a
+// clear error rather than overwriting its ownership.
+func (r *AgentClusterInstallReconciler) adoptSecret(
+	ctx context.Context,
+	secretObj *corev1.Secret,
+	clusterName string,
+	acp *controlplanev1alpha1.AgentControlPlane,
+) error {
+	alreadyOwned := metav1.IsControlledBy(secretObj, acp)
+	alreadyLabeled := secretObj.Labels[clusterv1.ClusterNameLabel] == clusterName
+	if alreadyOwned && alreadyLabeled {
+		return nil
+	}
+
+	if err := controllerutil.SetControllerReference(acp, secretObj, r.Scheme); err != nil {
+		return errors.Wrapf(err, "failed to adopt secret %s/%s", secretObj.Namespace, secretObj.Name)
+	}
+	if secretObj.Labels == nil {
+		secretObj.Labels = map[string]string{}
+	}
+	secretObj.Labels[clusterv1.ClusterNameLabel] = clusterName
+	return r.Client.Update(ctx, secretObj)
+}
+
 func (r *AgentClusterInstallReconciler) updateLabels(
 	ctx context.Context,
 	obj client.Object,
@@ -193,6 +272,13 @@ func isInstalled(aci *hiveext.AgentClusterInstall) bool {
 	return aci.Status.DebugInfo.State == aimodels.ClusterStatusAddingHosts
 }
 
+// isImported reports whether aci was created for a day-2 imported cluster rather than provisioned
+// by assisted-service: import mode populates ClusterMetadata directly at creation time and never
+// creates an ImageSetRef, since no install is performed.
+func isImported(aci *hiveext.AgentClusterInstall) bool {
+	return aci.Spec.ClusterMetadata != nil && aci.Spec.ImageSetRef == nil
+}
+
 func (r *AgentClusterInstallReconciler) ClusterKubeconfigSecretExists(
 	ctx context.Context,
 	clusterName, namespace string,
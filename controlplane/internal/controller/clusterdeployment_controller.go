@@ -18,6 +18,9 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"net"
+
 	"github.com/openshift-assisted/cluster-api-agent/controlplane/api/v1beta1"
 	hiveext "github.com/openshift/assisted-service/api/hiveextension/v1beta1"
 	hivev1 "github.com/openshift/hive/apis/hive/v1"
@@ -25,13 +28,44 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"time"
 )
 
+// Default HostPrefix per pod CIDR IP family, matching OpenShift SDN/OVN-Kubernetes conventions.
+const (
+	defaultIPv4HostPrefix = int32(23)
+	defaultIPv6HostPrefix = int32(64)
+
+	networkTypeOVNKubernetes = "OVNKubernetes"
+	networkTypeOpenShiftSDN  = "OpenShiftSDN"
+)
+
+// NetworkConfigError indicates that AgentConfigSpec/Cluster networking fields are missing or
+// incompatible (e.g. no VIPs configured, or a NetworkType that doesn't support the requested pod
+// CIDR IP family) and an AgentClusterInstall cannot be generated from them.
+type NetworkConfigError struct {
+	Reason string
+}
+
+func (e *NetworkConfigError) Error() string {
+	return fmt.Sprintf("invalid network configuration: %s", e.Reason)
+}
+
+// clusterImageSetFinalizer is set on the AgentControlPlane, not the ClusterImageSet: ClusterImageSet
+// is cluster-scoped, so it cannot carry an owner reference to a namespaced object and would
+// otherwise be orphaned when the AgentControlPlane is deleted (or fail clusterctl move's
+// owner-graph reachability check, since it has no path back to the Cluster). This reconciler
+// deletes the per-cluster ClusterImageSet and removes the finalizer itself once the
+// AgentControlPlane is marked for deletion; see cleanupClusterImageSet.
+const clusterImageSetFinalizer = "controlplane.cluster.x-k8s.io/agentcontrolplane-imageset"
+
 // ClusterDeploymentReconciler reconciles a ClusterDeployment object
 type ClusterDeploymentReconciler struct {
 	client.Client
@@ -42,9 +76,29 @@ type ClusterDeploymentReconciler struct {
 func (r *ClusterDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&hivev1.ClusterDeployment{}).
-		Watches(&v1beta1.AgentControlPlane{}, &handler.EnqueueRequestForObject{}).
+		Watches(&v1beta1.AgentControlPlane{}, handler.EnqueueRequestsFromMapFunc(r.mapAgentControlPlaneToClusterDeployment)).
 		Complete(r)
 }
+
+// mapAgentControlPlaneToClusterDeployment maps an AgentControlPlane event to a Reconcile request
+// for the ClusterDeployment it references via AgentConfigSpec.ClusterDeploymentRef, rather than one
+// keyed by the AgentControlPlane's own name: the two names are not guaranteed to match (see
+// IsAgentControlPlaneReferencingClusterDeployment), so an EnqueueRequestForObject watch would miss
+// the ClusterDeployment whenever they differ — most importantly when the AgentControlPlane is
+// deleted and cleanupClusterImageSet needs to run.
+func (r *ClusterDeploymentReconciler) mapAgentControlPlaneToClusterDeployment(_ context.Context, obj client.Object) []reconcile.Request {
+	acp, ok := obj.(*v1beta1.AgentControlPlane)
+	if !ok {
+		return nil
+	}
+	ref := acp.Spec.AgentConfigSpec.ClusterDeploymentRef
+	if ref == nil {
+		return nil
+	}
+	return []reconcile.Request{
+		{NamespacedName: client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}},
+	}
+}
 func (r *ClusterDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 
@@ -73,6 +127,9 @@ func (r *ClusterDeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Re
 	for _, acp := range agentCPList.Items {
 		if IsAgentControlPlaneReferencingClusterDeployment(acp, clusterDeployment) {
 			log.Info("ClusterDeployment is referenced by AgentControlPlane")
+			if !acp.DeletionTimestamp.IsZero() {
+				return r.cleanupClusterImageSet(ctx, clusterDeployment, acp)
+			}
 			return r.ensureAgentClusterInstall(ctx, clusterDeployment, acp)
 		}
 	}
@@ -109,6 +166,14 @@ func (r *ClusterDeploymentReconciler) ensureAgentClusterInstall(ctx context.Cont
 		)
 		return ctrl.Result{}, nil
 	}
+
+	if importRef := acp.Spec.AgentConfigSpec.ImportClusterRef; importRef != nil {
+		return r.ensureImportedAgentClusterInstall(ctx, clusterDeployment, acp, cluster, importRef)
+	}
+
+	// ClusterImageSet is named after the ClusterDeployment (i.e. one per cluster), and its cleanup
+	// on deletion is tracked via a finalizer rather than an owner reference; see
+	// clusterImageSetFinalizer.
 	imageSet := &hivev1.ClusterImageSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      clusterDeployment.Name,
@@ -124,17 +189,24 @@ func (r *ClusterDeploymentReconciler) ensureAgentClusterInstall(ctx context.Cont
 			return ctrl.Result{}, err
 		}
 	}
-
-	clusterNetwork := []hiveext.ClusterNetworkEntry{}
-
-	if cluster.Spec.ClusterNetwork != nil && cluster.Spec.ClusterNetwork.Pods != nil {
-		for _, cidrBlock := range cluster.Spec.ClusterNetwork.Pods.CIDRBlocks {
-			clusterNetwork = append(clusterNetwork, hiveext.ClusterNetworkEntry{CIDR: cidrBlock, HostPrefix: 23})
+	if !controllerutil.ContainsFinalizer(&acp, clusterImageSetFinalizer) {
+		controllerutil.AddFinalizer(&acp, clusterImageSetFinalizer)
+		if err := r.Client.Update(ctx, &acp); err != nil {
+			return ctrl.Result{}, err
 		}
 	}
-	serviceNetwork := []string{}
-	if cluster.Spec.ClusterNetwork != nil && cluster.Spec.ClusterNetwork.Services != nil {
-		serviceNetwork = cluster.Spec.ClusterNetwork.Services.CIDRBlocks
+
+	apiVIP, apiVIPs, err := vipsFromSpec(acp.Spec.AgentConfigSpec.APIVIPs, "APIVIPs")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	ingressVIP, ingressVIPs, err := vipsFromSpec(acp.Spec.AgentConfigSpec.IngressVIPs, "IngressVIPs")
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	networking, err := buildNetworking(cluster, acp.Spec.AgentConfigSpec, apiVIPs, ingressVIPs)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
 	log.Info("Creating agent cluster install for ClusterDeployment", "name", clusterDeployment.Name, "namespace", clusterDeployment.Namespace)
@@ -147,31 +219,215 @@ func (r *ClusterDeploymentReconciler) ensureAgentClusterInstall(ctx context.Cont
 			},
 		},
 		Spec: hiveext.AgentClusterInstallSpec{
-			// TODO: fix this stuff below
-			APIVIP:               acp.Spec.AgentConfigSpec.APIVIPs[0],
-			IngressVIP:           acp.Spec.AgentConfigSpec.IngressVIPs[0],
+			// APIVIP/IngressVIP (singular) are populated only when a single VIP was given, for
+			// backward-compat with assisted-service versions that don't read APIVIPs/IngressVIPs.
+			APIVIP:               apiVIP,
+			APIVIPs:              apiVIPs,
+			IngressVIP:           ingressVIP,
+			IngressVIPs:          ingressVIPs,
 			ClusterDeploymentRef: corev1.LocalObjectReference{Name: clusterDeployment.Name},
 			ProvisionRequirements: hiveext.ProvisionRequirements{
 				ControlPlaneAgents: int(acp.Spec.Replicas),
 			},
 			SSHPublicKey: acp.Spec.AgentConfigSpec.SSHAuthorizedKey,
 			ImageSetRef:  &hivev1.ClusterImageSetReference{Name: imageSet.Name},
-			Networking: hiveext.Networking{
-				ClusterNetwork: clusterNetwork,
-				ServiceNetwork: serviceNetwork,
-				MachineNetwork: acp.Spec.AgentConfigSpec.MachineNetwork,
-			},
+			Networking:   networking,
 		},
 	}
-	if err := r.Client.Create(ctx, agentClusterInstall); err != nil {
+	if err := controllerutil.SetOwnerReference(cluster, agentClusterInstall, r.Scheme); err != nil {
 		return ctrl.Result{}, err
 	}
+	// Tolerate AlreadyExists so a retry after a partial failure (ACI created, ClusterDeployment
+	// update below failed) doesn't wedge here permanently; see ensureImportedAgentClusterInstall,
+	// which applies the same tolerance for the same reason.
+	if err := r.Client.Create(ctx, agentClusterInstall); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+	}
 	clusterDeployment.Spec.ClusterInstallRef = &hivev1.ClusterInstallLocalReference{
 		Group:   hiveext.Group,
 		Version: hiveext.Version,
 		Kind:    "AgentClusterInstall",
 		Name:    agentClusterInstall.Name,
 	}
+	if err := controllerutil.SetOwnerReference(cluster, clusterDeployment, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
 	err = r.Client.Update(ctx, clusterDeployment)
 	return ctrl.Result{}, err
 }
+
+// cleanupClusterImageSet deletes the per-cluster ClusterImageSet owned (via clusterImageSetFinalizer)
+// by acp and removes the finalizer, allowing the AgentControlPlane deletion to proceed. It is the
+// counterpart to the ClusterImageSet creation and finalizer addition in ensureAgentClusterInstall,
+// run once acp.DeletionTimestamp is set.
+func (r *ClusterDeploymentReconciler) cleanupClusterImageSet(ctx context.Context, clusterDeployment *hivev1.ClusterDeployment, acp v1beta1.AgentControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	if !controllerutil.ContainsFinalizer(&acp, clusterImageSetFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	imageSet := &hivev1.ClusterImageSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterDeployment.Name,
+			Namespace: clusterDeployment.Namespace,
+		},
+	}
+	if err := r.Client.Delete(ctx, imageSet); err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	log.Info("Deleted ClusterImageSet for AgentControlPlane", "name", imageSet.Name, "namespace", imageSet.Namespace)
+
+	controllerutil.RemoveFinalizer(&acp, clusterImageSetFinalizer)
+	if err := r.Client.Update(ctx, &acp); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// ensureImportedAgentClusterInstall creates a day-2 AgentClusterInstall for a cluster that is
+// already installed outside of CAPI (e.g. a self-hosted hub cluster). Unlike a fresh install it
+// does not provision a ClusterImageSet or Networking/ProvisionRequirements: it simply points the
+// AgentClusterInstall at the user-supplied admin kubeconfig so that Agent CRs created for this
+// AgentControlPlane join the existing control plane as workers.
+func (r *ClusterDeploymentReconciler) ensureImportedAgentClusterInstall(
+	ctx context.Context,
+	clusterDeployment *hivev1.ClusterDeployment,
+	acp v1beta1.AgentControlPlane,
+	cluster *clusterv1.Cluster,
+	importRef *v1beta1.ImportClusterRef,
+) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	log.Info("Importing existing cluster for day-2 operations", "name", clusterDeployment.Name, "namespace", clusterDeployment.Namespace)
+
+	agentClusterInstall := &hiveext.AgentClusterInstall{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterDeployment.Name,
+			Namespace: clusterDeployment.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(&acp, v1beta1.GroupVersion.WithKind(agentControlPlaneKind)),
+			},
+		},
+		Spec: hiveext.AgentClusterInstallSpec{
+			APIVIP:               importRef.APIVIP,
+			ClusterDeploymentRef: corev1.LocalObjectReference{Name: clusterDeployment.Name},
+			ClusterMetadata: &hivev1.ClusterMetadata{
+				ClusterID:                importRef.ClusterID,
+				AdminKubeconfigSecretRef: corev1.LocalObjectReference{Name: importRef.AdminKubeconfigSecretRef.Name},
+			},
+		},
+	}
+	if err := controllerutil.SetOwnerReference(cluster, agentClusterInstall, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Tolerate AlreadyExists so a retry after a partial failure (ACI created, ClusterDeployment
+	// update below failed) doesn't wedge here permanently; see ensureAgentClusterInstall, which
+	// applies the same tolerance for the same reason.
+	if err := r.Client.Create(ctx, agentClusterInstall); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	clusterDeployment.Spec.ClusterInstallRef = &hivev1.ClusterInstallLocalReference{
+		Group:   hiveext.Group,
+		Version: hiveext.Version,
+		Kind:    "AgentClusterInstall",
+		Name:    agentClusterInstall.Name,
+	}
+	if err := controllerutil.SetOwnerReference(cluster, clusterDeployment, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	err := r.Client.Update(ctx, clusterDeployment)
+	return ctrl.Result{}, err
+}
+
+// vipsFromSpec validates that vips has at least one entry and returns it as both the legacy
+// singular VIP (populated only when exactly one VIP was given, for backward-compat with
+// assisted-service versions that only read the singular field) and the full slice.
+func vipsFromSpec(vips []string, fieldName string) (singular string, plural []string, err error) {
+	if len(vips) == 0 {
+		return "", nil, &NetworkConfigError{Reason: fmt.Sprintf("%s must have at least one entry", fieldName)}
+	}
+	if len(vips) == 1 {
+		singular = vips[0]
+	}
+	return singular, vips, nil
+}
+
+// buildNetworking derives the AgentClusterInstall Networking spec from the CAPI Cluster's
+// ClusterNetwork. Each pod CIDR's HostPrefix is derived from its IP family (23 for IPv4, 64 for
+// IPv6) unless overridden via AgentConfigSpec.PodCIDRHostPrefixes, which makes dual-stack pod
+// networks (one IPv4 + one IPv6 CIDR) work without extra configuration. NetworkType is validated
+// against both the pod CIDR families and the apiVIPs/ingressVIPs families, since OpenShiftSDN does
+// not support IPv6 on either.
+func buildNetworking(cluster *clusterv1.Cluster, agentConfigSpec v1beta1.AgentConfigSpec, apiVIPs, ingressVIPs []string) (hiveext.Networking, error) {
+	var clusterNetwork []hiveext.ClusterNetworkEntry
+	hasIPv6 := false
+	if cluster.Spec.ClusterNetwork != nil && cluster.Spec.ClusterNetwork.Pods != nil {
+		for _, cidrBlock := range cluster.Spec.ClusterNetwork.Pods.CIDRBlocks {
+			hostPrefix, isIPv6, err := hostPrefixForCIDR(cidrBlock, agentConfigSpec.PodCIDRHostPrefixes)
+			if err != nil {
+				return hiveext.Networking{}, err
+			}
+			hasIPv6 = hasIPv6 || isIPv6
+			clusterNetwork = append(clusterNetwork, hiveext.ClusterNetworkEntry{CIDR: cidrBlock, HostPrefix: hostPrefix})
+		}
+	}
+	if len(clusterNetwork) == 0 {
+		return hiveext.Networking{}, &NetworkConfigError{Reason: "Cluster has no pod network CIDRs configured"}
+	}
+
+	var serviceNetwork []string
+	if cluster.Spec.ClusterNetwork != nil && cluster.Spec.ClusterNetwork.Services != nil {
+		serviceNetwork = cluster.Spec.ClusterNetwork.Services.CIDRBlocks
+	}
+
+	networkType := agentConfigSpec.NetworkType
+	if networkType == "" {
+		networkType = networkTypeOVNKubernetes
+	}
+	hasIPv6VIP := vipsContainIPv6(apiVIPs) || vipsContainIPv6(ingressVIPs)
+	if (hasIPv6 || hasIPv6VIP) && networkType == networkTypeOpenShiftSDN {
+		return hiveext.Networking{}, &NetworkConfigError{
+			Reason: fmt.Sprintf("NetworkType %s does not support IPv6 pod networks or VIPs; use %s for dual-stack or IPv6-only clusters", networkTypeOpenShiftSDN, networkTypeOVNKubernetes),
+		}
+	}
+
+	return hiveext.Networking{
+		ClusterNetwork: clusterNetwork,
+		ServiceNetwork: serviceNetwork,
+		MachineNetwork: agentConfigSpec.MachineNetwork,
+		NetworkType:    networkType,
+	}, nil
+}
+
+// vipsContainIPv6 reports whether any address in vips is an IPv6 address. Entries that do not parse
+// as an IP address are skipped; neither this function nor vipsFromSpec checks the VIP format.
+func vipsContainIPv6(vips []string) bool {
+	for _, vip := range vips {
+		if ip := net.ParseIP(vip); ip != nil && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPrefixForCIDR returns the HostPrefix to use for cidr: the override in overrides if one is
+// keyed by that exact CIDR string, otherwise 23 for an IPv4 CIDR or 64 for an IPv6 one.
+func hostPrefixForCIDR(cidr string, overrides map[string]int32) (hostPrefix int32, isIPv6 bool, err error) {
+	_, ipNet, parseErr := net.ParseCIDR(cidr)
+	if parseErr != nil {
+		return 0, false, &NetworkConfigError{Reason: fmt.Sprintf("invalid pod CIDR %q: %v", cidr, parseErr)}
+	}
+	isIPv6 = ipNet.IP.To4() == nil
+
+	if override, ok := overrides[cidr]; ok {
+		return override, isIPv6, nil
+	}
+	if isIPv6 {
+		return defaultIPv6HostPrefix, true, nil
+	}
+	return defaultIPv4HostPrefix, false, nil
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openshift-assisted/cluster-api-agent/controlplane/api/v1beta1"
+	hiveext "github.com/openshift/assisted-service/api/hiveextension/v1beta1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// TestEnsureAgentClusterInstallOwnerGraph asserts that every namespaced object
+// ensureAgentClusterInstall creates or updates has an owner reference chain reaching the CAPI
+// Cluster, which is what clusterctl move's ownerGraph traversal requires. ClusterImageSet is
+// cluster-scoped and therefore cannot carry such a reference; it is covered instead by asserting
+// the AgentControlPlane picks up clusterImageSetFinalizer.
+func TestEnsureAgentClusterInstallOwnerGraph(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		clusterv1.AddToScheme,
+		hivev1.AddToScheme,
+		hiveext.AddToScheme,
+		v1beta1.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("failed to build scheme: %v", err)
+		}
+	}
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default", UID: "cluster-uid"},
+		Spec: clusterv1.ClusterSpec{
+			ClusterNetwork: &clusterv1.ClusterNetwork{
+				Pods: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/14"}},
+			},
+		},
+	}
+	acp := v1beta1.AgentControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-cluster",
+			Namespace: "default",
+			UID:       "acp-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(cluster, clusterv1.GroupVersion.WithKind("Cluster")),
+			},
+		},
+		Spec: v1beta1.AgentControlPlaneSpec{
+			Replicas: 3,
+			AgentConfigSpec: v1beta1.AgentConfigSpec{
+				APIVIPs:     []string{"192.168.1.1"},
+				IngressVIPs: []string{"192.168.1.2"},
+			},
+		},
+	}
+	clusterDeployment := &hivev1.ClusterDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster, &acp, clusterDeployment).Build()
+	r := &ClusterDeploymentReconciler{Client: fakeClient, Scheme: scheme}
+
+	ctx := context.Background()
+	if _, err := r.ensureAgentClusterInstall(ctx, clusterDeployment, acp); err != nil {
+		t.Fatalf("ensureAgentClusterInstall returned an error: %v", err)
+	}
+
+	aci := &hiveext.AgentClusterInstall{}
+	if err := fakeClient.Get(ctx, client.ObjectKey{Name: "test-cluster", Namespace: "default"}, aci); err != nil {
+		t.Fatalf("failed to get AgentClusterInstall: %v", err)
+	}
+	if !reachesCluster(aci, cluster) {
+		t.Errorf("AgentClusterInstall owner graph does not reach the Cluster: %+v", aci.OwnerReferences)
+	}
+
+	updatedCD := &hivev1.ClusterDeployment{}
+	if err := fakeClient.Get(ctx, client.ObjectKey{Name: "test-cluster", Namespace: "default"}, updatedCD); err != nil {
+		t.Fatalf("failed to get ClusterDeployment: %v", err)
+	}
+	if !reachesCluster(updatedCD, cluster) {
+		t.Errorf("ClusterDeployment owner graph does not reach the Cluster: %+v", updatedCD.OwnerReferences)
+	}
+
+	updatedACP := &v1beta1.AgentControlPlane{}
+	if err := fakeClient.Get(ctx, client.ObjectKey{Name: "test-cluster", Namespace: "default"}, updatedACP); err != nil {
+		t.Fatalf("failed to get AgentControlPlane: %v", err)
+	}
+	if !controllerutil.ContainsFinalizer(updatedACP, clusterImageSetFinalizer) {
+		t.Errorf("AgentControlPlane is missing %s, so its ClusterImageSet would leak on deletion", clusterImageSetFinalizer)
+	}
+}
+
+// TestCleanupClusterImageSet asserts that cleanupClusterImageSet, run once the AgentControlPlane
+// has a DeletionTimestamp, deletes the per-cluster ClusterImageSet and removes
+// clusterImageSetFinalizer so the AgentControlPlane deletion can proceed.
+func TestCleanupClusterImageSet(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		clusterv1.AddToScheme,
+		hivev1.AddToScheme,
+		hiveext.AddToScheme,
+		v1beta1.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("failed to build scheme: %v", err)
+		}
+	}
+
+	now := metav1.Now()
+	acp := &v1beta1.AgentControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-cluster",
+			Namespace:         "default",
+			UID:               "acp-uid",
+			Finalizers:        []string{clusterImageSetFinalizer},
+			DeletionTimestamp: &now,
+		},
+	}
+	imageSet := &hivev1.ClusterImageSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+	}
+	clusterDeployment := &hivev1.ClusterDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(clusterDeployment, imageSet, acp).Build()
+	r := &ClusterDeploymentReconciler{Client: fakeClient, Scheme: scheme}
+
+	ctx := context.Background()
+	if _, err := r.cleanupClusterImageSet(ctx, clusterDeployment, *acp); err != nil {
+		t.Fatalf("cleanupClusterImageSet returned an error: %v", err)
+	}
+
+	if err := fakeClient.Get(ctx, client.ObjectKey{Name: "test-cluster", Namespace: "default"}, &hivev1.ClusterImageSet{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected ClusterImageSet to be deleted, got err: %v", err)
+	}
+
+	// clusterImageSetFinalizer is the AgentControlPlane's only finalizer, so once it is removed the
+	// pending deletion completes and the object may already be gone.
+	updatedACP := &v1beta1.AgentControlPlane{}
+	err := fakeClient.Get(ctx, client.ObjectKey{Name: "test-cluster", Namespace: "default"}, updatedACP)
+	if err != nil && !apierrors.IsNotFound(err) {
+		t.Fatalf("failed to get AgentControlPlane: %v", err)
+	}
+	if err == nil && controllerutil.ContainsFinalizer(updatedACP, clusterImageSetFinalizer) {
+		t.Errorf("expected %s to be removed from AgentControlPlane", clusterImageSetFinalizer)
+	}
+}
+
+// TestCleanupClusterImageSetNoFinalizer asserts that cleanupClusterImageSet is a no-op when the
+// AgentControlPlane never picked up clusterImageSetFinalizer (e.g. an imported cluster, which
+// never creates a ClusterImageSet in the first place).
+func TestCleanupClusterImageSetNoFinalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{
+		clusterv1.AddToScheme,
+		hivev1.AddToScheme,
+		hiveext.AddToScheme,
+		v1beta1.AddToScheme,
+	} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("failed to build scheme: %v", err)
+		}
+	}
+
+	now := metav1.Now()
+	acp := v1beta1.AgentControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-cluster",
+			Namespace:         "default",
+			UID:               "acp-uid",
+			DeletionTimestamp: &now,
+		},
+	}
+	clusterDeployment := &hivev1.ClusterDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(clusterDeployment).Build()
+	r := &ClusterDeploymentReconciler{Client: fakeClient, Scheme: scheme}
+
+	ctx := context.Background()
+	if _, err := r.cleanupClusterImageSet(ctx, clusterDeployment, acp); err != nil {
+		t.Fatalf("cleanupClusterImageSet returned an error: %v", err)
+	}
+}
+
+// TestMapAgentControlPlaneToClusterDeployment asserts that the AgentControlPlane watch maps to a
+// request keyed by the referenced ClusterDeployment's namespace/name, not the AgentControlPlane's
+// own — otherwise an ACP deletion never re-enters Reconcile for a ClusterDeployment named
+// differently from the ACP, and cleanupClusterImageSet never runs.
+func TestMapAgentControlPlaneToClusterDeployment(t *testing.T) {
+	r := &ClusterDeploymentReconciler{}
+
+	acp := &v1beta1.AgentControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-acp", Namespace: "default"},
+		Spec: v1beta1.AgentControlPlaneSpec{
+			AgentConfigSpec: v1beta1.AgentConfigSpec{
+				ClusterDeploymentRef: &corev1.ObjectReference{
+					APIVersion: hivev1.SchemeGroupVersion.String(),
+					Kind:       "ClusterDeployment",
+					Namespace:  "default",
+					Name:       "test-cluster-deployment",
+				},
+			},
+		},
+	}
+
+	requests := r.mapAgentControlPlaneToClusterDeployment(context.Background(), acp)
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1: %+v", len(requests), requests)
+	}
+	want := client.ObjectKey{Namespace: "default", Name: "test-cluster-deployment"}
+	if requests[0].NamespacedName != want {
+		t.Errorf("NamespacedName = %+v, want %+v", requests[0].NamespacedName, want)
+	}
+
+	if requests := r.mapAgentControlPlaneToClusterDeployment(context.Background(), &v1beta1.AgentControlPlane{}); requests != nil {
+		t.Errorf("expected no requests for an AgentControlPlane without a ClusterDeploymentRef, got %+v", requests)
+	}
+}
+
+// reachesCluster reports whether obj carries an owner reference pointing directly at cluster.
+func reachesCluster(obj metav1.Object, cluster *clusterv1.Cluster) bool {
+	return hasOwnerRef(obj, "Cluster", cluster.Name)
+}
+
+// hasOwnerRef reports whether obj carries an owner reference with the given kind and name.
+func hasOwnerRef(obj metav1.Object, kind, name string) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == kind && ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuildNetworking(t *testing.T) {
+	tests := []struct {
+		name             string
+		podCIDRs         []string
+		apiVIPs          []string
+		ingressVIPs      []string
+		networkType      string
+		wantHostPrefixes []int32
+		wantNetworkType  string
+		wantErr          bool
+	}{
+		{
+			name:             "single-stack v4",
+			podCIDRs:         []string{"10.128.0.0/14"},
+			apiVIPs:          []string{"192.168.1.1"},
+			ingressVIPs:      []string{"192.168.1.2"},
+			wantHostPrefixes: []int32{defaultIPv4HostPrefix},
+			wantNetworkType:  networkTypeOVNKubernetes,
+		},
+		{
+			name:             "single-stack v6",
+			podCIDRs:         []string{"fd01::/48"},
+			apiVIPs:          []string{"fd02::1"},
+			ingressVIPs:      []string{"fd02::2"},
+			wantHostPrefixes: []int32{defaultIPv6HostPrefix},
+			wantNetworkType:  networkTypeOVNKubernetes,
+		},
+		{
+			name:             "dual-stack v4 and v6",
+			podCIDRs:         []string{"10.128.0.0/14", "fd01::/48"},
+			apiVIPs:          []string{"192.168.1.1", "fd02::1"},
+			ingressVIPs:      []string{"192.168.1.2", "fd02::2"},
+			networkType:      networkTypeOVNKubernetes,
+			wantHostPrefixes: []int32{defaultIPv4HostPrefix, defaultIPv6HostPrefix},
+			wantNetworkType:  networkTypeOVNKubernetes,
+		},
+		{
+			name:        "OpenShiftSDN rejected for IPv6 pod network",
+			podCIDRs:    []string{"fd01::/48"},
+			apiVIPs:     []string{"fd02::1"},
+			ingressVIPs: []string{"fd02::2"},
+			networkType: networkTypeOpenShiftSDN,
+			wantErr:     true,
+		},
+		{
+			name:        "OpenShiftSDN rejected for IPv6 VIPs on an IPv4 pod network",
+			podCIDRs:    []string{"10.128.0.0/14"},
+			apiVIPs:     []string{"fd02::1"},
+			ingressVIPs: []string{"fd02::2"},
+			networkType: networkTypeOpenShiftSDN,
+			wantErr:     true,
+		},
+		{
+			name:     "no pod CIDRs is an error",
+			podCIDRs: nil,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &clusterv1.Cluster{
+				Spec: clusterv1.ClusterSpec{
+					ClusterNetwork: &clusterv1.ClusterNetwork{
+						Pods: &clusterv1.NetworkRanges{CIDRBlocks: tt.podCIDRs},
+					},
+				},
+			}
+			agentConfigSpec := v1beta1.AgentConfigSpec{NetworkType: tt.networkType}
+
+			networking, err := buildNetworking(cluster, agentConfigSpec, tt.apiVIPs, tt.ingressVIPs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				if _, ok := err.(*NetworkConfigError); !ok {
+					t.Fatalf("expected a *NetworkConfigError, got %T: %v", err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if networking.NetworkType != tt.wantNetworkType {
+				t.Errorf("NetworkType = %q, want %q", networking.NetworkType, tt.wantNetworkType)
+			}
+			if len(networking.ClusterNetwork) != len(tt.wantHostPrefixes) {
+				t.Fatalf("got %d ClusterNetwork entries, want %d", len(networking.ClusterNetwork), len(tt.wantHostPrefixes))
+			}
+			for i, entry := range networking.ClusterNetwork {
+				if entry.CIDR != tt.podCIDRs[i] {
+					t.Errorf("entry %d CIDR = %q, want %q", i, entry.CIDR, tt.podCIDRs[i])
+				}
+				if entry.HostPrefix != tt.wantHostPrefixes[i] {
+					t.Errorf("entry %d HostPrefix = %d, want %d", i, entry.HostPrefix, tt.wantHostPrefixes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVipsFromSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		vips       []string
+		wantSingle string
+		wantErr    bool
+	}{
+		{name: "single VIP populates legacy singular field", vips: []string{"192.168.1.1"}, wantSingle: "192.168.1.1"},
+		{name: "multiple VIPs leave the singular field empty", vips: []string{"192.168.1.1", "fd00::1"}, wantSingle: ""},
+		{name: "no VIPs is an error", vips: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			singular, plural, err := vipsFromSpec(tt.vips, "APIVIPs")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if singular != tt.wantSingle {
+				t.Errorf("singular = %q, want %q", singular, tt.wantSingle)
+			}
+			if len(plural) != len(tt.vips) {
+				t.Errorf("plural = %v, want %v", plural, tt.vips)
+			}
+		})
+	}
+}